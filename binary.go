@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// sniffSampleSize is how much of a file is inspected to decide whether it's
+// binary, mirroring the buffer size http.DetectContentType itself expects.
+const sniffSampleSize = 512
+
+// validBinaryModes are the accepted values for -binary.
+var validBinaryModes = map[string]bool{
+	"include": true,
+	"skip":    true,
+	"hexdump": true,
+	"summary": true,
+}
+
+// binarySniff is the result of inspecting a file's first sniffSampleSize
+// bytes to decide how -binary should treat it.
+type binarySniff struct {
+	isBinary bool
+	mimeType string
+}
+
+// sniffBinary peeks at r without consuming it, so the caller can still read
+// the full content afterwards regardless of the verdict.
+func sniffBinary(r *bufio.Reader) (binarySniff, error) {
+	sample, err := r.Peek(sniffSampleSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return binarySniff{}, err
+	}
+
+	mimeType := http.DetectContentType(sample)
+	isBinary := !isTextualMIME(mimeType) || bytes.IndexByte(sample, 0) != -1 || tooManyNonPrintable(sample)
+	return binarySniff{isBinary: isBinary, mimeType: mimeType}, nil
+}
+
+func isTextualMIME(mimeType string) bool {
+	base, _, _ := strings.Cut(mimeType, ";")
+	switch {
+	case strings.HasPrefix(base, "text/"):
+		return true
+	case base == "application/json", base == "application/xml", base == "application/yaml", base == "application/x-yaml":
+		return true
+	default:
+		return false
+	}
+}
+
+// tooManyNonPrintable reports whether more than 30% of sample falls outside
+// the printable ASCII + whitespace range.
+func tooManyNonPrintable(sample []byte) bool {
+	if len(sample) == 0 {
+		return false
+	}
+	nonPrintable := 0
+	for _, b := range sample {
+		switch {
+		case b == '\t' || b == '\n' || b == '\r':
+		case b < 0x20 || b > 0x7e:
+			nonPrintable++
+		}
+	}
+	return float64(nonPrintable)/float64(len(sample)) > 0.3
+}
+
+// renderBinary applies -binary's handling to a file already identified as
+// binary, returning the replacement body (and its exact length, needed
+// upfront by formats like tar) or ok=false if the record should be omitted
+// entirely (mode "skip").
+func renderBinary(mode string, sniff binarySniff, content io.Reader) (body []byte, ok bool, err error) {
+	switch mode {
+	case "skip":
+		return nil, false, nil
+	case "summary":
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return nil, false, err
+		}
+		sum := sha256.Sum256(data)
+		summary := fmt.Sprintf("Binary file (sha256: %x, size: %d bytes, mime: %s)\n", sum, len(data), sniff.mimeType)
+		return []byte(summary), true, nil
+	case "hexdump":
+		var buf bytes.Buffer
+		dumper := hex.Dumper(&buf)
+		if _, err := io.Copy(dumper, content); err != nil {
+			return nil, false, err
+		}
+		if err := dumper.Close(); err != nil {
+			return nil, false, err
+		}
+		return buf.Bytes(), true, nil
+	default: // "include"
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return nil, false, err
+		}
+		return data, true, nil
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSniffBinaryDetectsText(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("package main\n\nfunc main() {}\n"))
+	sniff, err := sniffBinary(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sniff.isBinary {
+		t.Error("Go source should not be classified as binary")
+	}
+}
+
+func TestSniffBinaryDetectsNulByte(t *testing.T) {
+	r := bufio.NewReader(bytes.NewReader([]byte("abc\x00def")))
+	sniff, err := sniffBinary(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sniff.isBinary {
+		t.Error("content with a NUL byte should be classified as binary")
+	}
+}
+
+func TestSniffBinaryDetectsHighNonPrintableRatio(t *testing.T) {
+	sample := bytes.Repeat([]byte{0x01, 0x02, 0x03, 0x04}, 50)
+	r := bufio.NewReader(bytes.NewReader(sample))
+	sniff, err := sniffBinary(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sniff.isBinary {
+		t.Error("mostly non-printable content should be classified as binary")
+	}
+}
+
+func TestRenderBinarySkip(t *testing.T) {
+	_, ok, err := renderBinary("skip", binarySniff{}, strings.NewReader("irrelevant"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("skip mode should report ok=false so the record is omitted")
+	}
+}
+
+func TestRenderBinarySummaryReportsOriginalSize(t *testing.T) {
+	content := "0123456789abcde" // 15 bytes
+	body, ok, err := renderBinary("summary", binarySniff{mimeType: "application/octet-stream"}, strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("summary mode should keep the record")
+	}
+	if !strings.Contains(string(body), "size: 15 bytes") {
+		t.Errorf("summary body = %q, want it to mention the original 15-byte size", body)
+	}
+}
+
+func TestRenderBinaryHexdump(t *testing.T) {
+	body, ok, err := renderBinary("hexdump", binarySniff{}, strings.NewReader("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("hexdump mode should keep the record")
+	}
+	if !strings.Contains(string(body), "68 69") {
+		t.Errorf("hexdump body = %q, want it to contain the hex bytes for \"hi\"", body)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// openSource resolves a -source flag value into an fs.FS that
+// generateDirectoryTree, collectFilePaths, and processFile can walk with
+// fs.WalkDir. Supported schemes:
+//
+//	dir://path            os.DirFS(path) (default if no scheme is given)
+//	zip://archive.zip      a zip archive, no extraction needed
+//	tar://archive.tar[.gz] a tar (optionally gzipped) archive
+//	git://repo@ref         a tree object from a local git repository, read
+//	                       straight out of its object store without a
+//	                       working copy checkout
+func openSource(source string) (fs.FS, error) {
+	scheme, arg, ok := strings.Cut(source, "://")
+	if !ok {
+		return os.DirFS(source), nil
+	}
+
+	switch scheme {
+	case "dir":
+		return os.DirFS(arg), nil
+	case "zip":
+		return openZipFS(arg)
+	case "tar":
+		return openTarFS(arg)
+	case "git":
+		return openGitFS(arg)
+	default:
+		return nil, fmt.Errorf("unknown -source scheme %q (want dir, zip, tar, or git)", scheme)
+	}
+}
+
+func openZipFS(archivePath string) (fs.FS, error) {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening zip %s: %w", archivePath, err)
+	}
+	// r.Close() is intentionally not deferred: the *zip.ReadCloser (and the
+	// fs.FS it embeds) must stay usable for the life of the walk, which
+	// outlives this call. The process exits shortly after, reclaiming the fd.
+	return r, nil
+}
+
+func openTarFS(archivePath string) (fs.FS, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening tar %s: %w", archivePath, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(archivePath, ".gz") || strings.HasSuffix(archivePath, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("opening gzip %s: %w", archivePath, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	mfs := newMemFS()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading tar %s: %w", archivePath, err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			mfs.addDir(hdr.Name)
+		case tar.TypeReg:
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s from %s: %w", hdr.Name, archivePath, err)
+			}
+			mfs.addFile(hdr.Name, content, hdr.ModTime)
+		}
+	}
+	return mfs, nil
+}
+
+// openGitFS reads "path/to/repo" or "path/to/repo@ref" (ref defaults to
+// HEAD) and loads every blob reachable from that revision's tree into a
+// memFS, without touching the repository's working copy.
+func openGitFS(arg string) (fs.FS, error) {
+	repoPath, ref, hasRef := strings.Cut(arg, "@")
+	if !hasRef || ref == "" {
+		ref = "HEAD"
+	}
+
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening git repo %s: %w", repoPath, err)
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s in %s: %w", ref, repoPath, err)
+	}
+
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("loading commit %s: %w", hash, err)
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("loading tree for commit %s: %w", hash, err)
+	}
+
+	mfs := newMemFS()
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("walking tree for commit %s: %w", hash, err)
+		}
+		if !entry.Mode.IsFile() {
+			continue
+		}
+		blob, err := object.GetBlob(repo.Storer, entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("loading blob %s: %w", name, err)
+		}
+		content, err := readBlob(blob)
+		if err != nil {
+			return nil, fmt.Errorf("reading blob %s: %w", name, err)
+		}
+		mfs.addFile(name, content, commit.Author.When)
+	}
+	return mfs, nil
+}
+
+func readBlob(blob *object.Blob) ([]byte, error) {
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
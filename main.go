@@ -3,22 +3,26 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
-	"sync"
 )
 
-// Shared state for output file management
+// Shared state for output file management. All writes go through the single
+// writer goroutine in processFiles, so this needs no locking of its own.
 type outputState struct {
 	currentFile *os.File
 	currentSize int64
 	fileIndex   int
 	maxFileSize int64
 	outputDir   string
-	mutex       sync.Mutex
+	format      string
+	writer      RecordWriter
 }
 
 // File metadata structure
@@ -26,61 +30,97 @@ type fileMetadata struct {
 	name    string
 	relPath string
 	size    int64
-	content []byte
 }
 
 // Configuration options
 type config struct {
 	rootPath        string
+	source          string
 	maxFileSizeKB   int
 	outputDir       string
+	outputFormat    string
 	skipHiddenFiles bool
-	// NEW: Maps for storing items to skip for efficient lookups
-	skipExts map[string]struct{}
-	skipDirs map[string]struct{}
+	ignoreFileNames []string
+	includePatterns []string
+	excludePatterns []string
+	binaryMode      string
+	workers         int
+	sortOrder       string
+	matcher         *Matcher
+	fsys            fs.FS
 }
 
-func main() {
-	cfg := &config{}
+// stringSliceFlag implements flag.Value for a repeatable string flag. The
+// first Set call replaces whatever default values were pre-populated, so a
+// flag can ship a sensible default while still being fully overridable.
+type stringSliceFlag struct {
+	values  *[]string
+	changed bool
+}
+
+func (s *stringSliceFlag) String() string {
+	if s.values == nil {
+		return ""
+	}
+	return strings.Join(*s.values, ",")
+}
+
+func (s *stringSliceFlag) Set(v string) error {
+	if !s.changed {
+		*s.values = nil
+		s.changed = true
+	}
+	*s.values = append(*s.values, v)
+	return nil
+}
 
-	// NEW: String vars to capture comma-separated flag values
-	var skipExtsStr, skipDirsStr string
+func main() {
+	cfg := &config{
+		ignoreFileNames: []string{".gitignore"},
+	}
 
-	flag.StringVar(&cfg.rootPath, "root", ".", "Root directory to process")
+	flag.StringVar(&cfg.rootPath, "root", ".", "Root directory to process (used when -source is not given)")
+	flag.StringVar(&cfg.source, "source", "", "Source tree to dump: dir://path, zip://archive.zip, tar://archive.tar[.gz], or git://repo@ref (defaults to dir://<root>)")
 	flag.IntVar(&cfg.maxFileSizeKB, "max-size", 1024, "Maximum output file size in KB")
 	flag.StringVar(&cfg.outputDir, "output", "output", "Output directory for generated files")
 	flag.BoolVar(&cfg.skipHiddenFiles, "skip-hidden", true, "Skip hidden files and directories (default: true)")
-	// NEW: Define new command-line flags for skipping extensions and directories
-	flag.StringVar(&skipExtsStr, "skip-ext", "", "Comma-separated list of file extensions to skip (e.g., .log,.tmp)")
-	flag.StringVar(&skipDirsStr, "skip-dir", "", "Comma-separated list of directory names to skip (e.g., node_modules,.git)")
+	flag.StringVar(&cfg.outputFormat, "format", "text", "Output format: text, ndjson, or tar")
+	flag.Var(&stringSliceFlag{values: &cfg.ignoreFileNames}, "ignore-file", "Name of a gitignore-style file to honor while walking, repeatable (default .gitignore)")
+	flag.Var(&stringSliceFlag{values: &cfg.includePatterns}, "include", "Gitignore-style pattern to force-include, repeatable")
+	flag.Var(&stringSliceFlag{values: &cfg.excludePatterns}, "exclude", "Gitignore-style pattern to exclude, repeatable")
+	flag.StringVar(&cfg.binaryMode, "binary", "include", "How to handle binary files: skip, hexdump, summary, or include")
+	flag.IntVar(&cfg.workers, "workers", runtime.NumCPU(), "Number of concurrent file-processing workers")
+	flag.StringVar(&cfg.sortOrder, "sort", "path", "Order to emit records in: path, size, mtime, or none (fastest, non-deterministic)")
 	flag.Parse()
 
-	if _, err := os.Stat(cfg.rootPath); os.IsNotExist(err) {
-		log.Fatalf("Root directory does not exist: %s", cfg.rootPath)
+	if !validBinaryModes[cfg.binaryMode] {
+		log.Fatalf("Invalid -binary %q (want skip, hexdump, summary, or include)", cfg.binaryMode)
+	}
+	if !validSortOrders[cfg.sortOrder] {
+		log.Fatalf("Invalid -sort %q (want path, size, mtime, or none)", cfg.sortOrder)
+	}
+	if cfg.workers < 1 {
+		log.Fatal("-workers must be at least 1")
+	}
+
+	if cfg.source == "" {
+		if _, err := os.Stat(cfg.rootPath); os.IsNotExist(err) {
+			log.Fatalf("Root directory does not exist: %s", cfg.rootPath)
+		}
+		cfg.source = "dir://" + cfg.rootPath
 	}
 
 	if cfg.maxFileSizeKB <= 0 {
 		log.Fatal("Max file size must be positive")
 	}
 
-	// NEW: Process the string flags into maps for efficient lookup
-	cfg.skipExts = make(map[string]struct{})
-	if skipExtsStr != "" {
-		for _, ext := range strings.Split(skipExtsStr, ",") {
-			trimmedExt := strings.TrimSpace(ext)
-			if !strings.HasPrefix(trimmedExt, ".") {
-				trimmedExt = "." + trimmedExt
-			}
-			cfg.skipExts[trimmedExt] = struct{}{}
-		}
+	fsys, err := openSource(cfg.source)
+	if err != nil {
+		log.Fatalf("Failed to open -source %q: %v", cfg.source, err)
 	}
+	cfg.fsys = fsys
 
-	cfg.skipDirs = make(map[string]struct{})
-	if skipDirsStr != "" {
-		for _, dir := range strings.Split(skipDirsStr, ",") {
-			cfg.skipDirs[strings.TrimSpace(dir)] = struct{}{}
-		}
-	}
+	cfg.matcher = newMatcher(cfg.fsys, cfg.ignoreFileNames, cfg.includePatterns, cfg.excludePatterns)
 
 	if err := os.MkdirAll(cfg.outputDir, 0755); err != nil {
 		log.Fatalf("Failed to create output directory: %v", err)
@@ -96,86 +136,87 @@ func main() {
 		log.Fatalf("Failed to collect file paths: %v", err)
 	}
 
+	filePaths, err = sortFilePaths(cfg, filePaths)
+	if err != nil {
+		log.Fatalf("Failed to sort file paths: %v", err)
+	}
+
 	maxBytes := int64(cfg.maxFileSizeKB) * 1024
 	state := &outputState{
 		fileIndex:   1,
 		maxFileSize: maxBytes,
 		outputDir:   cfg.outputDir,
+		format:      cfg.outputFormat,
+	}
+
+	writer, err := newRecordWriter(cfg.outputFormat, state)
+	if err != nil {
+		log.Fatalf("Invalid -format: %v", err)
 	}
+	state.writer = writer
 
 	if err := state.createNewOutputFile(); err != nil {
 		log.Fatalf("Failed to create initial output file: %v", err)
 	}
-	defer state.currentFile.Close()
+	defer state.Close()
 
-	if _, err := state.currentFile.WriteString("DIRECTORY STRUCTURE:\n" + directoryTree + "\n\n"); err != nil {
+	if err := state.writer.WriteDirectoryTree(directoryTree); err != nil {
 		log.Fatalf("Failed to write directory structure: %v", err)
 	}
-	state.currentSize = int64(len(directoryTree)) + 2
 
 	processFiles(filePaths, cfg, state)
 
 	log.Println("File processing completed successfully")
 }
 
-func isHiddenFile(path string) bool {
-	base := filepath.Base(path)
+func isHiddenFile(fsPath string) bool {
+	base := path.Base(fsPath)
 	return strings.HasPrefix(base, ".")
 }
 
 // generateDirectoryTree creates a string representation of the directory structure
 func generateDirectoryTree(cfg *config) (string, error) {
 	var builder strings.Builder
-	err := filepath.Walk(cfg.rootPath, func(path string, info fs.FileInfo, err error) error {
+	cfg.matcher.Reset()
+	err := fs.WalkDir(cfg.fsys, ".", func(fsPath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// MODIFIED: Enhanced skip logic
-		baseName := info.Name()
+		// Skip the root directory itself
+		if fsPath == "." {
+			return nil
+		}
 
 		// Skip hidden files and directories if configured
-		if cfg.skipHiddenFiles && isHiddenFile(path) {
-			if info.IsDir() {
-				return filepath.SkipDir // Skip the entire directory
+		if cfg.skipHiddenFiles && isHiddenFile(fsPath) {
+			if d.IsDir() {
+				return fs.SkipDir
 			}
-			return nil // Skip the file
+			return nil
 		}
 
-		if info.IsDir() {
-			// Skip specified directory names
-			if _, found := cfg.skipDirs[baseName]; found {
-				return filepath.SkipDir
-			}
-		} else {
-			// Skip specified file extensions
-			if _, found := cfg.skipExts[filepath.Ext(baseName)]; found {
-				return nil
+		if cfg.matcher.ShouldSkip(fsPath, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
 			}
-		}
-
-		// Calculate relative path and depth
-		relPath, err := filepath.Rel(cfg.rootPath, path)
-		if err != nil {
-			return err
-		}
-
-		// Skip the root directory itself
-		if relPath == "." {
 			return nil
 		}
+		if d.IsDir() {
+			cfg.matcher.EnterDir(fsPath)
+		}
 
 		// Calculate depth based on the number of separators
-		depth := strings.Count(relPath, string(filepath.Separator))
+		depth := strings.Count(fsPath, "/")
 		indent := strings.Repeat("  ", depth)
 
 		// Add directory or file entry
 		prefix := "├── "
-		if info.IsDir() {
+		if d.IsDir() {
 			prefix = "└── "
 		}
 
-		builder.WriteString(indent + prefix + filepath.Base(path) + "\n")
+		builder.WriteString(indent + prefix + path.Base(fsPath) + "\n")
 		return nil
 	})
 
@@ -186,40 +227,42 @@ func generateDirectoryTree(cfg *config) (string, error) {
 	return builder.String(), nil
 }
 
-// collectFilePaths gathers all file paths in the directory tree
+// collectFilePaths gathers the fs.FS-relative paths of every file to dump
 func collectFilePaths(cfg *config) ([]string, error) {
 	var filePaths []string
-	err := filepath.Walk(cfg.rootPath, func(path string, info fs.FileInfo, err error) error {
+	cfg.matcher.Reset()
+	err := fs.WalkDir(cfg.fsys, ".", func(fsPath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-
-		// MODIFIED: Enhanced skip logic
-		baseName := info.Name()
+		if fsPath == "." {
+			return nil
+		}
 
 		// Skip hidden files and directories if configured
-		if cfg.skipHiddenFiles && isHiddenFile(path) {
-			if info.IsDir() {
-				return filepath.SkipDir // Skip the entire directory
+		if cfg.skipHiddenFiles && isHiddenFile(fsPath) {
+			if d.IsDir() {
+				return fs.SkipDir
 			}
-			return nil // Skip the file
+			return nil
 		}
 
-		// If it's a directory, check if it should be skipped
-		if info.IsDir() {
-			if _, found := cfg.skipDirs[baseName]; found {
-				return filepath.SkipDir
+		if cfg.matcher.ShouldSkip(fsPath, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
 			}
-			return nil // Continue traversal but don't add directory path to the list
+			return nil
 		}
 
-		// If it's a file, check its extension
-		if _, found := cfg.skipExts[filepath.Ext(baseName)]; found {
-			return nil // Skip this file
+		// If it's a directory, consult the matcher but don't add its own
+		// path to the file list, and push its ignore file (if any) for its
+		// children.
+		if d.IsDir() {
+			cfg.matcher.EnterDir(fsPath)
+			return nil
 		}
 
-		// If all checks pass, add the file path
-		filePaths = append(filePaths, path)
+		filePaths = append(filePaths, fsPath)
 		return nil
 	})
 
@@ -230,95 +273,14 @@ func collectFilePaths(cfg *config) ([]string, error) {
 	return filePaths, nil
 }
 
-// processFiles handles parallel file processing
-func processFiles(filePaths []string, cfg *config, state *outputState) {
-	var wg sync.WaitGroup
-	fileChan := make(chan string, len(filePaths))
-
-	// Create worker pool
-	numWorkers := 4 // Adjust based on your system
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go worker(fileChan, &wg, cfg, state)
-	}
-
-	// Send file paths to workers
-	for _, path := range filePaths {
-		fileChan <- path
-	}
-	close(fileChan)
-
-	wg.Wait()
-}
-
-// worker processes files from the channel
-func worker(fileChan <-chan string, wg *sync.WaitGroup, cfg *config, state *outputState) {
-	defer wg.Done()
-
-	for filePath := range fileChan {
-		processFile(filePath, cfg, state)
-	}
-}
-
-// processFile reads a file and writes its content to the output
-func processFile(filePath string, cfg *config, state *outputState) {
-	// Note: An explicit check here is redundant because collectFilePaths
-	// already filters the list, but it's kept for robustness.
-	if cfg.skipHiddenFiles && isHiddenFile(filePath) {
-		return
-	}
-
-	// Read file content
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		log.Printf("Error reading file %s: %v", filePath, err)
-		return
-	}
-
-	// Get file info for metadata
-	info, err := os.Stat(filePath)
-	if err != nil {
-		log.Printf("Error getting file info for %s: %v", filePath, err)
-		return
-	}
-
-	// Calculate relative path
-	relPath, err := filepath.Rel(cfg.rootPath, filePath)
-	if err != nil {
-		log.Printf("Error calculating relative path for %s: %v", filePath, err)
-		return
-	}
-
-	// Create metadata
-	metadata := fileMetadata{
-		name:    info.Name(),
-		relPath: relPath,
-		size:    info.Size(),
-		content: content,
-	}
-
-	// Write to output file
-	if err := state.writeFileWithMetadata(metadata); err != nil {
-		log.Printf("Error writing file %s to output: %v", filePath, err)
-	}
-}
-
-// writeFileWithMetadata writes file content with metadata to the current output file
-func (s *outputState) writeFileWithMetadata(metadata fileMetadata) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	// Format the metadata header
-	header := fmt.Sprintf(
-		"File: %s\nPath: %s\nSize: %d bytes\nFILE CONTENT START:\n",
-		metadata.name,
-		metadata.relPath,
-		metadata.size,
-	)
-	footer := "\nFILE CONTENT END\n\n"
-
-	// Calculate total size needed
-	totalSize := int64(len(header)) + metadata.size + int64(len(footer))
+// writeFileWithMetadata writes file content with metadata to the current
+// output file, rolling over to a new output file first if the record
+// wouldn't fit. contentLength is the exact number of bytes content will
+// yield; it's tracked separately from metadata.size because the two can
+// differ (e.g. -binary hexdump/summary report the original file's size in
+// metadata while streaming a shorter rendered blob as content).
+func (s *outputState) writeFileWithMetadata(metadata fileMetadata, content io.Reader, contentLength int64) error {
+	totalSize := s.writer.EstimateSize(metadata, contentLength)
 
 	// Check if we need a new output file
 	if s.currentSize+totalSize > s.maxFileSize && s.currentSize > 0 {
@@ -327,33 +289,23 @@ func (s *outputState) writeFileWithMetadata(metadata fileMetadata) error {
 		}
 	}
 
-	// Write header, content, and footer
-	if _, err := s.currentFile.WriteString(header); err != nil {
-		return err
-	}
-	if _, err := s.currentFile.Write(metadata.content); err != nil {
-		return err
-	}
-	if _, err := s.currentFile.WriteString(footer); err != nil {
-		return err
-	}
-
-	// Update current size
-	s.currentSize += totalSize
-	return nil
+	return s.writer.WriteRecord(metadata, content, contentLength)
 }
 
 // createNewOutputFile closes the current file and creates a new one
 func (s *outputState) createNewOutputFile() error {
 	// Close current file if it exists
 	if s.currentFile != nil {
+		if err := s.writer.Close(); err != nil {
+			return err
+		}
 		if err := s.currentFile.Close(); err != nil {
 			return err
 		}
 	}
 
 	// Create new output file
-	fileName := filepath.Join(s.outputDir, fmt.Sprintf("output_%03d.txt", s.fileIndex))
+	fileName := filepath.Join(s.outputDir, fmt.Sprintf("output_%03d%s", s.fileIndex, outputExtension(s.format)))
 	file, err := os.Create(fileName)
 	if err != nil {
 		return err
@@ -362,5 +314,13 @@ func (s *outputState) createNewOutputFile() error {
 	s.currentFile = file
 	s.fileIndex++
 	s.currentSize = 0
-	return nil
-}
\ No newline at end of file
+	return s.writer.Rotate()
+}
+
+// Close finalizes the active record writer and closes the underlying file.
+func (s *outputState) Close() error {
+	if err := s.writer.Close(); err != nil {
+		return err
+	}
+	return s.currentFile.Close()
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is a single compiled line from an ignore file or an
+// -include/-exclude flag.
+type ignoreRule struct {
+	regexp  *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreScope holds the rules contributed by the ignore file(s) found in a
+// single directory. relDir is that directory's path relative to the
+// matcher's root, using "/" separators ("." for the root itself).
+type ignoreScope struct {
+	relDir string
+	rules  []ignoreRule
+}
+
+// Matcher implements gitignore-style path filtering: nested ignore files
+// take precedence over their ancestors, "!" negates a rule, and -include
+// patterns act as a final override for paths excluded by everything else.
+type Matcher struct {
+	fsys            fs.FS
+	ignoreFileNames []string
+	includeRules    []ignoreRule
+	excludeRules    []ignoreRule
+	scopes          []ignoreScope
+}
+
+func newMatcher(fsys fs.FS, ignoreFileNames, includePatterns, excludePatterns []string) *Matcher {
+	return &Matcher{
+		fsys:            fsys,
+		ignoreFileNames: ignoreFileNames,
+		includeRules:    compileRules(includePatterns, "."),
+		excludeRules:    compileRules(excludePatterns, "."),
+	}
+}
+
+// Reset drops any scopes accumulated by a previous walk so the matcher can
+// be reused for a fresh fs.WalkDir over the same tree.
+func (m *Matcher) Reset() {
+	m.scopes = nil
+	m.EnterDir(".")
+}
+
+// EnterDir loads the ignore file(s) (if any) for relDir and pushes them as
+// a new scope, after popping any scopes left behind by the walk moving on
+// from a sibling subtree.
+func (m *Matcher) EnterDir(relDir string) {
+	m.popScopesNotUnder(relDir)
+
+	var rules []ignoreRule
+	for _, name := range m.ignoreFileNames {
+		ignorePath := name
+		if relDir != "." {
+			ignorePath = path.Join(relDir, name)
+		}
+		data, err := fs.ReadFile(m.fsys, ignorePath)
+		if err != nil {
+			continue
+		}
+		rules = append(rules, compileRules(strings.Split(string(data), "\n"), relDir)...)
+	}
+	if len(rules) > 0 {
+		m.scopes = append(m.scopes, ignoreScope{relDir: relDir, rules: rules})
+	}
+}
+
+func (m *Matcher) popScopesNotUnder(relDir string) {
+	kept := m.scopes[:0]
+	for _, s := range m.scopes {
+		if s.relDir == "." || relDir == s.relDir || strings.HasPrefix(relDir, s.relDir+"/") {
+			kept = append(kept, s)
+		}
+	}
+	m.scopes = kept
+}
+
+// ShouldSkip reports whether relPath (slash-separated, relative to the
+// matcher's root) should be excluded from the walk. Scopes are consulted
+// from the root down so that deeper ignore files win, -exclude is applied
+// on top of that, and -include has the final say.
+func (m *Matcher) ShouldSkip(relPath string, isDir bool) bool {
+	skip := false
+	for _, scope := range m.scopes {
+		testPath := relPath
+		if scope.relDir != "." {
+			testPath = strings.TrimPrefix(relPath, scope.relDir+"/")
+		}
+		applyRules(scope.rules, testPath, isDir, &skip, true)
+	}
+	applyRules(m.excludeRules, relPath, isDir, &skip, true)
+	applyRules(m.includeRules, relPath, isDir, &skip, false)
+
+	return skip
+}
+
+// applyRules evaluates rules against path in order, each match overriding
+// skip. matchSets is the value a plain (non-negated) match assigns; "!"
+// negated rules assign the opposite, e.g. re-including a path an earlier
+// ignore rule excluded, or excluding one an earlier -include rule kept.
+func applyRules(rules []ignoreRule, path string, isDir bool, skip *bool, matchSets bool) {
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.regexp.MatchString(path) {
+			if rule.negate {
+				*skip = !matchSets
+			} else {
+				*skip = matchSets
+			}
+		}
+	}
+}
+
+// compileRules parses one pattern per line (as found in a .gitignore-style
+// file, or passed via repeated -include/-exclude flags) into rules scoped
+// to scopeDir.
+func compileRules(patterns []string, scopeDir string) []ignoreRule {
+	var rules []ignoreRule
+	for _, pattern := range patterns {
+		pattern = strings.TrimRight(pattern, "\r")
+		trimmed := strings.TrimSpace(pattern)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		negate := false
+		if strings.HasPrefix(trimmed, "!") {
+			negate = true
+			trimmed = trimmed[1:]
+		}
+		dirOnly := strings.HasSuffix(trimmed, "/") && trimmed != "/"
+		if dirOnly {
+			trimmed = strings.TrimSuffix(trimmed, "/")
+		}
+
+		rules = append(rules, ignoreRule{
+			regexp:  compilePatternRegexp(trimmed),
+			negate:  negate,
+			dirOnly: dirOnly,
+		})
+	}
+	return rules
+}
+
+// compilePatternRegexp translates a single gitignore-style pattern
+// (supporting "**", "*", "?", "[...]", leading "/" anchoring) into a
+// regexp matching a "/"-separated path relative to the pattern's scope.
+func compilePatternRegexp(pattern string) *regexp.Regexp {
+	anchored := strings.HasPrefix(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	// A pattern with no slash (other than a leading one we just stripped)
+	// matches at any depth, exactly like gitignore.
+	if !anchored && !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case "**":
+			if last {
+				sb.WriteString(".*")
+			} else {
+				sb.WriteString("(?:.*/)?")
+			}
+		default:
+			sb.WriteString(translateGlobSegment(segment))
+			if !last {
+				sb.WriteString("/")
+			}
+		}
+	}
+	sb.WriteString("$")
+
+	// Patterns come from trusted config/ignore files written by repo
+	// maintainers, and every character we emit is either escaped or drawn
+	// from a small known-safe set, so this always compiles.
+	return regexp.MustCompile(sb.String())
+}
+
+// translateGlobSegment converts a single path segment (no "/") of a
+// gitignore glob into the equivalent regexp fragment.
+func translateGlobSegment(segment string) string {
+	var sb strings.Builder
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		switch c {
+		case '*':
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(segment[i:], ']')
+			if end == -1 {
+				sb.WriteString(regexp.QuoteMeta(segment[i:]))
+				i = len(segment)
+				continue
+			}
+			sb.WriteString(segment[i : i+end+1])
+			i += end
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestMatcherIncludeOverridesExclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.js":    &fstest.MapFile{},
+		"vendor.js": &fstest.MapFile{},
+	}
+	m := newMatcher(fsys, nil, []string{"app.js"}, []string{"*.js"})
+	m.Reset()
+
+	if m.ShouldSkip("app.js", false) {
+		t.Error("app.js should survive -include overriding -exclude")
+	}
+	if !m.ShouldSkip("vendor.js", false) {
+		t.Error("vendor.js should still be excluded by *.js")
+	}
+}
+
+func TestMatcherNestedIgnoreFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		".gitignore":        &fstest.MapFile{Data: []byte("*.log\n")},
+		"build.log":         &fstest.MapFile{},
+		"sub/.gitignore":    &fstest.MapFile{Data: []byte("!important.log\n")},
+		"sub/build.log":     &fstest.MapFile{},
+		"sub/important.log": &fstest.MapFile{},
+	}
+	m := newMatcher(fsys, []string{".gitignore"}, nil, nil)
+	m.Reset()
+
+	if !m.ShouldSkip("build.log", false) {
+		t.Error("build.log should be excluded by the root .gitignore")
+	}
+
+	m.EnterDir("sub")
+	if !m.ShouldSkip("sub/build.log", false) {
+		t.Error("sub/build.log should still be excluded by the inherited root rule")
+	}
+	if m.ShouldSkip("sub/important.log", false) {
+		t.Error("sub/important.log should be re-included by the nested .gitignore's negation")
+	}
+}
+
+func TestMatcherDirOnlyPattern(t *testing.T) {
+	m := newMatcher(nil, nil, nil, []string{"node_modules/"})
+	m.Reset()
+
+	if !m.ShouldSkip("node_modules", true) {
+		t.Error("node_modules/ should exclude the directory")
+	}
+	if m.ShouldSkip("node_modules.json", false) {
+		t.Error("node_modules/ should not match a same-prefix file")
+	}
+}
+
+func TestCompilePatternRegexpGlobStar(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "sub/main.go", true},
+		{"/root.go", "root.go", true},
+		{"/root.go", "sub/root.go", false},
+		{"**/vendor/**", "a/vendor/b/c.go", true},
+		{"**/vendor/**", "vendor/c.go", true},
+		{"**/vendor/**", "xvendor/c.go", false},
+	}
+	for _, c := range cases {
+		re := compilePatternRegexp(c.pattern)
+		if got := re.MatchString(c.path); got != c.want {
+			t.Errorf("pattern %q matching %q: got %v, want %v", c.pattern, c.path, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// memEntry is one file or directory in a memFS.
+type memEntry struct {
+	name     string
+	content  []byte
+	isDir    bool
+	modTime  time.Time
+	children []string // base names, directories only
+}
+
+// memFS is a minimal in-memory fs.FS, used to present archive formats that
+// don't support random access on their own (tar) or that are read from a
+// non-filesystem object store (git) as an ordinary walkable tree.
+type memFS struct {
+	entries map[string]*memEntry
+}
+
+func newMemFS() *memFS {
+	return &memFS{entries: map[string]*memEntry{
+		".": {name: ".", isDir: true},
+	}}
+}
+
+// addFile registers a file at name (any leading/trailing slashes and "."
+// segments are normalized), creating any missing parent directories.
+func (m *memFS) addFile(name string, content []byte, modTime time.Time) {
+	name = cleanMemPath(name)
+	if name == "." {
+		return
+	}
+	parent := m.ensureDir(path.Dir(name))
+	base := path.Base(name)
+	m.entries[name] = &memEntry{name: base, content: content, modTime: modTime}
+	parent.children = append(parent.children, base)
+}
+
+// addDir registers an empty directory (archives may list directories with
+// no files directly inside them).
+func (m *memFS) addDir(name string) {
+	m.ensureDir(cleanMemPath(name))
+}
+
+func (m *memFS) ensureDir(dir string) *memEntry {
+	dir = cleanMemPath(dir)
+	if e, ok := m.entries[dir]; ok {
+		return e
+	}
+	parentPath := path.Dir(dir)
+	if parentPath == dir {
+		parentPath = "."
+	}
+	parent := m.ensureDir(parentPath)
+	e := &memEntry{name: path.Base(dir), isDir: true}
+	m.entries[dir] = e
+	parent.children = append(parent.children, e.name)
+	return e
+}
+
+func cleanMemPath(name string) string {
+	name = path.Clean("/" + name)
+	return cleanLeadingSlash(name)
+}
+
+func cleanLeadingSlash(name string) string {
+	if name == "/" {
+		return "."
+	}
+	return name[1:]
+}
+
+func (m *memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := m.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if e.isDir {
+		return &memDir{fsys: m, path: name, entry: e}, nil
+	}
+	return &memFile{entry: e, Reader: bytes.NewReader(e.content)}, nil
+}
+
+// ReadDir implements fs.ReadDirFS so fs.WalkDir doesn't need to open a
+// directory just to list it.
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, ok := m.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	if !e.isDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	children := append([]string(nil), e.children...)
+	sort.Strings(children)
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, child := range children {
+		childPath := child
+		if name != "." {
+			childPath = name + "/" + child
+		}
+		entries = append(entries, memDirEntry{m.entries[childPath]})
+	}
+	return entries, nil
+}
+
+type memDirEntry struct{ entry *memEntry }
+
+func (e memDirEntry) Name() string               { return e.entry.name }
+func (e memDirEntry) IsDir() bool                { return e.entry.isDir }
+func (e memDirEntry) Type() fs.FileMode          { return memFileInfo{e.entry}.Mode().Type() }
+func (e memDirEntry) Info() (fs.FileInfo, error) { return memFileInfo{e.entry}, nil }
+
+type memFileInfo struct{ entry *memEntry }
+
+func (i memFileInfo) Name() string { return i.entry.name }
+func (i memFileInfo) Size() int64  { return int64(len(i.entry.content)) }
+func (i memFileInfo) Mode() fs.FileMode {
+	if i.entry.isDir {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
+func (i memFileInfo) ModTime() time.Time { return i.entry.modTime }
+func (i memFileInfo) IsDir() bool        { return i.entry.isDir }
+func (i memFileInfo) Sys() any           { return nil }
+
+// memFile is the fs.File returned for a regular file.
+type memFile struct {
+	entry *memEntry
+	*bytes.Reader
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return memFileInfo{f.entry}, nil }
+func (f *memFile) Close() error               { return nil }
+
+// memDir is the fs.ReadDirFile returned for a directory. fs.WalkDir
+// normally lists via memFS.ReadDir directly (memFS implements
+// fs.ReadDirFS), so this is mostly a fallback for callers that open the
+// directory themselves.
+type memDir struct {
+	fsys    *memFS
+	path    string
+	entry   *memEntry
+	entries []fs.DirEntry
+	offset  int
+	listed  bool
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return memFileInfo{d.entry}, nil }
+func (d *memDir) Close() error               { return nil }
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: errors.New("is a directory")}
+}
+
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		all, err := d.fsys.ReadDir(d.path)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = all
+		d.listed = true
+	}
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
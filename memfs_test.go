@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMemFSConformsToFSTestFS(t *testing.T) {
+	mfs := newMemFS()
+	mfs.addFile("a.txt", []byte("hello"), time.Time{})
+	mfs.addFile("sub/b.txt", []byte("world"), time.Time{})
+	mfs.addDir("empty")
+
+	if err := fstest.TestFS(mfs, "a.txt", "sub/b.txt", "sub", "empty"); err != nil {
+		t.Fatal(err)
+	}
+}
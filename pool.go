@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"sync"
+)
+
+// validSortOrders are the accepted values for -sort.
+var validSortOrders = map[string]bool{
+	"path":  true,
+	"size":  true,
+	"mtime": true,
+	"none":  true,
+}
+
+// sortFilePaths orders filePaths according to cfg.sortOrder before they're
+// handed to the worker pool. "none" leaves collectFilePaths' walk order
+// (already deterministic) untouched and lets the pool emit records as they
+// finish, trading determinism for throughput.
+func sortFilePaths(cfg *config, filePaths []string) ([]string, error) {
+	switch cfg.sortOrder {
+	case "none":
+		return filePaths, nil
+	case "path":
+		sorted := append([]string(nil), filePaths...)
+		sort.Strings(sorted)
+		return sorted, nil
+	case "size", "mtime":
+		sorted := append([]string(nil), filePaths...)
+		infos := make(map[string]fs.FileInfo, len(sorted))
+		for _, p := range sorted {
+			info, err := fs.Stat(cfg.fsys, p)
+			if err != nil {
+				return nil, fmt.Errorf("statting %s: %w", p, err)
+			}
+			infos[p] = info
+		}
+		sort.Slice(sorted, func(i, j int) bool {
+			a, b := infos[sorted[i]], infos[sorted[j]]
+			if cfg.sortOrder == "size" {
+				return a.Size() < b.Size()
+			}
+			return a.ModTime().Before(b.ModTime())
+		})
+		return sorted, nil
+	default:
+		return filePaths, nil
+	}
+}
+
+// preparedRecord is a processed file, tagged with its position in the
+// original (sorted) file list so the writer can restore that order even
+// though the workers that produced it finish out of sequence.
+//
+// Workers only fully buffer a file's content into body when -binary has
+// rendered it into a synthetic replacement (hexdump/summary) that has to be
+// built from the whole file anyway. Otherwise stream is set and the writer
+// reopens fsPath itself and streams it straight from cfg.fsys once the
+// record's turn comes, so the common case never holds a whole file in
+// memory at once.
+type preparedRecord struct {
+	index    int
+	metadata fileMetadata
+	body     []byte
+	stream   bool // true: writer should open and stream metadata.relPath itself
+	skipped  bool // true for a binary file dropped by -binary skip
+	err      error
+}
+
+// recordHeap is a min-heap of preparedRecords keyed on index, used by the
+// writer goroutine to hold back out-of-order results until their turn.
+type recordHeap []preparedRecord
+
+func (h recordHeap) Len() int            { return len(h) }
+func (h recordHeap) Less(i, j int) bool  { return h[i].index < h[j].index }
+func (h recordHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *recordHeap) Push(x interface{}) { *h = append(*h, x.(preparedRecord)) }
+func (h *recordHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// pendingLimit bounds how many completed-but-not-yet-written records the
+// writer goroutine is allowed to hold in its reordering heap at once, so a
+// slow file at the current write position can't let every faster file
+// behind it pile up unboundedly on a large tree.
+func pendingLimit(workers int) int {
+	limit := workers * 4
+	if limit < 1 {
+		limit = 1
+	}
+	return limit
+}
+
+// processFiles runs cfg.workers goroutines over filePaths through a bounded
+// job channel, and a single writer goroutine that consumes their results. If
+// cfg.sortOrder is "none" records are written as soon as they arrive;
+// otherwise the writer holds out-of-order results in a recordHeap keyed on
+// the file's position in filePaths, so the output is deterministic
+// regardless of which worker finishes first. tokens bounds that heap: a job
+// is only dispatched once a token is free, and a token is only freed once
+// the writer actually writes a record, so a slow file at the front of the
+// queue can't let completed work behind it pile up past pendingLimit.
+func processFiles(filePaths []string, cfg *config, state *outputState) {
+	jobs := make(chan int, cfg.workers)
+	results := make(chan preparedRecord, cfg.workers)
+	tokens := make(chan struct{}, pendingLimit(cfg.workers))
+
+	var workersWG sync.WaitGroup
+	workersWG.Add(cfg.workers)
+	for i := 0; i < cfg.workers; i++ {
+		go func() {
+			defer workersWG.Done()
+			for idx := range jobs {
+				results <- prepareFile(idx, filePaths[idx], cfg)
+			}
+		}()
+	}
+
+	var writerWG sync.WaitGroup
+	writerWG.Add(1)
+	go func() {
+		defer writerWG.Done()
+		writeResults(results, cfg, state, tokens)
+	}()
+
+	for idx := range filePaths {
+		tokens <- struct{}{}
+		jobs <- idx
+	}
+	close(jobs)
+
+	workersWG.Wait()
+	close(results)
+	writerWG.Wait()
+}
+
+// writeResults drains results and hands each preparedRecord to state in
+// order. With sortOrder "none" it writes as results arrive; otherwise it
+// buffers out-of-order arrivals in a recordHeap until the next record due is
+// available. Each write frees one token, letting processFiles dispatch the
+// next job.
+func writeResults(results <-chan preparedRecord, cfg *config, state *outputState, tokens chan struct{}) {
+	if cfg.sortOrder == "none" {
+		for rec := range results {
+			writeRecord(rec, cfg, state)
+			<-tokens
+		}
+		return
+	}
+
+	pending := &recordHeap{}
+	heap.Init(pending)
+	next := 0
+	for rec := range results {
+		heap.Push(pending, rec)
+		for pending.Len() > 0 && (*pending)[0].index == next {
+			writeRecord(heap.Pop(pending).(preparedRecord), cfg, state)
+			<-tokens
+			next++
+		}
+	}
+	// Shouldn't happen (every job produces exactly one result), but guards
+	// against losing records if it ever does.
+	for pending.Len() > 0 {
+		writeRecord(heap.Pop(pending).(preparedRecord), cfg, state)
+		<-tokens
+	}
+}
+
+// writeRecord writes a single preparedRecord to state. For a streamed
+// record it reopens metadata.relPath from cfg.fsys so the file's content
+// never has to be held in memory by the worker that produced the record.
+func writeRecord(rec preparedRecord, cfg *config, state *outputState) {
+	if rec.err != nil {
+		log.Printf("%v", rec.err)
+		return
+	}
+	if rec.skipped {
+		return
+	}
+
+	if rec.stream {
+		file, err := cfg.fsys.Open(rec.metadata.relPath)
+		if err != nil {
+			log.Printf("Error opening file %s to write: %v", rec.metadata.relPath, err)
+			return
+		}
+		defer file.Close()
+		if err := state.writeFileWithMetadata(rec.metadata, file, rec.metadata.size); err != nil {
+			log.Printf("Error writing file %s to output: %v", rec.metadata.relPath, err)
+		}
+		return
+	}
+
+	if err := state.writeFileWithMetadata(rec.metadata, bytes.NewReader(rec.body), int64(len(rec.body))); err != nil {
+		log.Printf("Error writing file %s to output: %v", rec.metadata.relPath, err)
+	}
+}
+
+// prepareFile stats fsPath and, for -binary modes that need to inspect
+// content, sniffs and (if the file turns out to be binary) fully renders it
+// into a synthetic replacement. Plain text under the common case (-binary
+// include, or a file that sniffs as text) is left unread: the returned
+// record is marked stream so the writer streams it straight from cfg.fsys
+// when its turn comes, rather than every worker materializing the whole
+// file in memory.
+func prepareFile(index int, fsPath string, cfg *config) preparedRecord {
+	info, err := fs.Stat(cfg.fsys, fsPath)
+	if err != nil {
+		return preparedRecord{index: index, err: fmt.Errorf("error getting file info for %s: %w", fsPath, err)}
+	}
+
+	metadata := fileMetadata{
+		name:    info.Name(),
+		relPath: fsPath,
+		size:    info.Size(),
+	}
+
+	if cfg.binaryMode == "include" {
+		return preparedRecord{index: index, metadata: metadata, stream: true}
+	}
+
+	file, err := cfg.fsys.Open(fsPath)
+	if err != nil {
+		return preparedRecord{index: index, err: fmt.Errorf("error opening file %s: %w", fsPath, err)}
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+	sniff, err := sniffBinary(buffered)
+	if err != nil {
+		return preparedRecord{index: index, err: fmt.Errorf("error sniffing file %s: %w", fsPath, err)}
+	}
+	if !sniff.isBinary {
+		return preparedRecord{index: index, metadata: metadata, stream: true}
+	}
+
+	body, ok, err := renderBinary(cfg.binaryMode, sniff, buffered)
+	if err != nil {
+		return preparedRecord{index: index, err: fmt.Errorf("error rendering binary file %s: %w", fsPath, err)}
+	}
+	if !ok {
+		return preparedRecord{index: index, skipped: true} // -binary skip
+	}
+	// metadata.size stays the original file's size; body (and thus the
+	// record's content length) is the shorter rendered blurb.
+	return preparedRecord{index: index, metadata: metadata, body: body}
+}
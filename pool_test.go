@@ -0,0 +1,233 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestWriteResultsReordersOutOfOrderRecords(t *testing.T) {
+	dir := t.TempDir()
+	state := &outputState{outputDir: dir, format: "text", maxFileSize: 1 << 20, fileIndex: 1}
+	state.writer = &textRecordWriter{state: state}
+	if err := state.createNewOutputFile(); err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	results := make(chan preparedRecord, 4)
+	// Deliberately out of order: 2, 0, 3, 1.
+	results <- preparedRecord{index: 2, metadata: fileMetadata{name: "c", relPath: "c"}, body: []byte("C")}
+	results <- preparedRecord{index: 0, metadata: fileMetadata{name: "a", relPath: "a"}, body: []byte("A")}
+	results <- preparedRecord{index: 3, metadata: fileMetadata{name: "d", relPath: "d"}, body: []byte("D")}
+	results <- preparedRecord{index: 1, metadata: fileMetadata{name: "b", relPath: "b"}, body: []byte("B")}
+	close(results)
+
+	writeResults(results, &config{sortOrder: "path"}, state, fullTokens(4))
+
+	data, err := os.ReadFile(filepath.Join(dir, "output_001.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if name, ok := strings.CutPrefix(line, "File: "); ok {
+			names = append(names, name)
+		}
+	}
+	want := []string{"a", "b", "c", "d"}
+	if len(names) != len(want) {
+		t.Fatalf("wrote files in order %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("wrote files in order %v, want %v", names, want)
+			break
+		}
+	}
+}
+
+func TestWriteResultsSkipsErroredAndSkippedRecords(t *testing.T) {
+	dir := t.TempDir()
+	state := &outputState{outputDir: dir, format: "text", maxFileSize: 1 << 20, fileIndex: 1}
+	state.writer = &textRecordWriter{state: state}
+	if err := state.createNewOutputFile(); err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	results := make(chan preparedRecord, 3)
+	results <- preparedRecord{index: 0, metadata: fileMetadata{name: "a", relPath: "a"}, body: []byte("A")}
+	results <- preparedRecord{index: 1, skipped: true}
+	results <- preparedRecord{index: 2, err: os.ErrNotExist}
+	close(results)
+
+	writeResults(results, &config{sortOrder: "path"}, state, fullTokens(3))
+
+	data, err := os.ReadFile(filepath.Join(dir, "output_001.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "File: a") {
+		t.Error("expected file a to be written")
+	}
+	if strings.Count(string(data), "File: ") != 1 {
+		t.Errorf("expected exactly one record, got content: %q", data)
+	}
+}
+
+func TestSortFilePaths(t *testing.T) {
+	now := time.Now()
+	fsys := fstest.MapFS{
+		"b.txt": &fstest.MapFile{Data: []byte("bb"), ModTime: now.Add(2 * time.Hour)},
+		"a.txt": &fstest.MapFile{Data: []byte("aaaaa"), ModTime: now},
+		"c.txt": &fstest.MapFile{Data: []byte("c"), ModTime: now.Add(time.Hour)},
+	}
+	paths := []string{"b.txt", "a.txt", "c.txt"}
+
+	cfg := &config{fsys: fsys, sortOrder: "path"}
+	got, err := sortFilePaths(cfg, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.txt", "b.txt", "c.txt"}; !equalStrings(got, want) {
+		t.Errorf("-sort path = %v, want %v", got, want)
+	}
+
+	cfg.sortOrder = "size"
+	got, err = sortFilePaths(cfg, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"c.txt", "b.txt", "a.txt"}; !equalStrings(got, want) {
+		t.Errorf("-sort size = %v, want %v", got, want)
+	}
+
+	cfg.sortOrder = "mtime"
+	got, err = sortFilePaths(cfg, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.txt", "c.txt", "b.txt"}; !equalStrings(got, want) {
+		t.Errorf("-sort mtime = %v, want %v", got, want)
+	}
+
+	cfg.sortOrder = "none"
+	got, err = sortFilePaths(cfg, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(got, paths) {
+		t.Errorf("-sort none = %v, want untouched %v", got, paths)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fullTokens returns a tokens channel pre-loaded with n entries, standing in
+// for processFiles' job-dispatch loop so writeResults' <-tokens releases
+// never block in a test that calls it directly.
+func fullTokens(n int) chan struct{} {
+	tokens := make(chan struct{}, n)
+	for i := 0; i < n; i++ {
+		tokens <- struct{}{}
+	}
+	return tokens
+}
+
+func TestPrepareFileStreamsPlainTextUnderDefaultBinaryMode(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt": &fstest.MapFile{Data: []byte("hello world")},
+	}
+	cfg := &config{fsys: fsys, binaryMode: "include"}
+
+	rec := prepareFile(0, "a.txt", cfg)
+	if rec.err != nil {
+		t.Fatal(rec.err)
+	}
+	if !rec.stream {
+		t.Error("prepareFile should mark a plain file under -binary include as stream, not buffer its body")
+	}
+	if rec.body != nil {
+		t.Error("prepareFile should not have read the file's content under -binary include")
+	}
+}
+
+func TestPrepareFileStreamsTextEvenWithBinarySniffing(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt": &fstest.MapFile{Data: []byte("hello world")},
+	}
+	cfg := &config{fsys: fsys, binaryMode: "skip"}
+
+	rec := prepareFile(0, "a.txt", cfg)
+	if rec.err != nil {
+		t.Fatal(rec.err)
+	}
+	if !rec.stream {
+		t.Error("prepareFile should stream text files even when -binary sniffing is enabled")
+	}
+}
+
+func TestPrepareFileBuffersRenderedBinary(t *testing.T) {
+	fsys := fstest.MapFS{
+		"bin.dat": &fstest.MapFile{Data: []byte{0x00, 0x01, 0x02, 0x03}},
+	}
+	cfg := &config{fsys: fsys, binaryMode: "summary"}
+
+	rec := prepareFile(0, "bin.dat", cfg)
+	if rec.err != nil {
+		t.Fatal(rec.err)
+	}
+	if rec.stream {
+		t.Error("a rendered binary summary must carry its own body, not stream from source")
+	}
+	if rec.body == nil {
+		t.Error("expected a rendered summary body")
+	}
+	if rec.metadata.size != 4 {
+		t.Errorf("metadata.size = %d, want original file size 4", rec.metadata.size)
+	}
+}
+
+func TestWriteRecordStreamsFromSource(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt": &fstest.MapFile{Data: []byte("streamed content")},
+	}
+	cfg := &config{fsys: fsys}
+	dir := t.TempDir()
+	state := &outputState{outputDir: dir, format: "text", maxFileSize: 1 << 20, fileIndex: 1}
+	state.writer = &textRecordWriter{state: state}
+	if err := state.createNewOutputFile(); err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	rec := preparedRecord{
+		index:    0,
+		metadata: fileMetadata{name: "a.txt", relPath: "a.txt", size: 17},
+		stream:   true,
+	}
+	writeRecord(rec, cfg, state)
+
+	data, err := os.ReadFile(filepath.Join(dir, "output_001.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "streamed content") {
+		t.Errorf("output = %q, want it to contain the streamed file's content", data)
+	}
+}
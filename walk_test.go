@@ -0,0 +1,39 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCollectFilePathsAgainstMapFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"README.md":       &fstest.MapFile{},
+		".hidden":         &fstest.MapFile{},
+		"src/main.go":     &fstest.MapFile{},
+		"src/.gitignore":  &fstest.MapFile{Data: []byte("*.tmp\n")},
+		"src/scratch.tmp": &fstest.MapFile{},
+		"vendor/lib.go":   &fstest.MapFile{},
+	}
+	cfg := &config{
+		fsys:            fsys,
+		skipHiddenFiles: true,
+		matcher:         newMatcher(fsys, []string{".gitignore"}, nil, []string{"vendor/"}),
+	}
+
+	got, err := collectFilePaths(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+
+	want := []string{"README.md", "src/main.go"}
+	if len(got) != len(want) {
+		t.Fatalf("collectFilePaths() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("collectFilePaths()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// RecordWriter encodes file records into the current output file using a
+// specific on-disk format. Implementations are stateful: Rotate must be
+// called whenever outputState opens a new underlying file, and Close must
+// be called before that file is closed so any trailing framing (e.g. a tar
+// footer) gets flushed.
+type RecordWriter interface {
+	// EstimateSize returns the approximate number of bytes WriteRecord will
+	// add to the current output file for metadata plus contentLength bytes
+	// of content, used to decide whether a rollover is needed before
+	// writing.
+	EstimateSize(metadata fileMetadata, contentLength int64) int64
+	// WriteRecord streams content (exactly contentLength bytes) into the
+	// current output file using the format's framing. contentLength may
+	// differ from metadata.size (e.g. a binary file rendered as a hexdump
+	// or summary reports its original size in metadata while streaming a
+	// shorter rendered blob as content).
+	WriteRecord(metadata fileMetadata, content io.Reader, contentLength int64) error
+	// WriteDirectoryTree emits the directory listing produced once up front,
+	// before any file records.
+	WriteDirectoryTree(tree string) error
+	// Rotate is called after outputState opens a new underlying file and
+	// should (re)initialize any per-file framing state.
+	Rotate() error
+	// Close flushes and finalizes any per-file framing state. It does not
+	// close the underlying *os.File; outputState owns that.
+	Close() error
+}
+
+func newRecordWriter(format string, state *outputState) (RecordWriter, error) {
+	switch format {
+	case "text":
+		return &textRecordWriter{state: state}, nil
+	case "ndjson":
+		return &ndjsonRecordWriter{state: state}, nil
+	case "tar":
+		return &tarRecordWriter{state: state}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q (want text, ndjson, or tar)", format)
+	}
+}
+
+func outputExtension(format string) string {
+	switch format {
+	case "ndjson":
+		return ".ndjson"
+	case "tar":
+		return ".tar"
+	default:
+		return ".txt"
+	}
+}
+
+// textRecordWriter reproduces the original human-readable framing:
+//
+//	File: <name>
+//	Path: <relPath>
+//	Size: <size> bytes
+//	FILE CONTENT START:
+//	<raw content>
+//	FILE CONTENT END
+type textRecordWriter struct {
+	state *outputState
+}
+
+func (w *textRecordWriter) EstimateSize(metadata fileMetadata, contentLength int64) int64 {
+	return int64(len(textHeader(metadata))) + contentLength + int64(len(textFooter))
+}
+
+func (w *textRecordWriter) WriteRecord(metadata fileMetadata, content io.Reader, contentLength int64) error {
+	s := w.state
+	header := textHeader(metadata)
+	if _, err := s.currentFile.WriteString(header); err != nil {
+		return err
+	}
+	n, err := io.Copy(s.currentFile, content)
+	if err != nil {
+		return err
+	}
+	if _, err := s.currentFile.WriteString(textFooter); err != nil {
+		return err
+	}
+	s.currentSize += int64(len(header)) + n + int64(len(textFooter))
+	return nil
+}
+
+func (w *textRecordWriter) WriteDirectoryTree(tree string) error {
+	s := w.state
+	text := "DIRECTORY STRUCTURE:\n" + tree + "\n\n"
+	if _, err := s.currentFile.WriteString(text); err != nil {
+		return err
+	}
+	s.currentSize += int64(len(text))
+	return nil
+}
+
+func (w *textRecordWriter) Rotate() error { return nil }
+func (w *textRecordWriter) Close() error  { return nil }
+
+const textFooter = "\nFILE CONTENT END\n\n"
+
+func textHeader(metadata fileMetadata) string {
+	return fmt.Sprintf(
+		"File: %s\nPath: %s\nSize: %d bytes\nFILE CONTENT START:\n",
+		metadata.name, metadata.relPath, metadata.size,
+	)
+}
+
+// ndjsonRecordWriter emits one JSON object per line, with content
+// base64-encoded so arbitrary binary payloads round-trip unambiguously.
+type ndjsonRecordWriter struct {
+	state *outputState
+}
+
+type ndjsonRecord struct {
+	Type          string `json:"type"`
+	Name          string `json:"name,omitempty"`
+	Path          string `json:"path,omitempty"`
+	Size          int64  `json:"size,omitempty"`
+	Content       string `json:"content,omitempty"`
+	ContentBase64 bool   `json:"content_base64,omitempty"`
+}
+
+func (w *ndjsonRecordWriter) EstimateSize(metadata fileMetadata, contentLength int64) int64 {
+	// base64 inflates content by ~4/3; the JSON envelope adds a small
+	// constant overhead on top.
+	return (contentLength*4)/3 + 256
+}
+
+func (w *ndjsonRecordWriter) WriteRecord(metadata fileMetadata, content io.Reader, contentLength int64) error {
+	s := w.state
+	raw, err := json.Marshal(ndjsonRecord{Type: "file", Name: metadata.name, Path: metadata.relPath, Size: metadata.size})
+	if err != nil {
+		return err
+	}
+	// Splice the streamed base64 content in as the last field so we never
+	// have to buffer the whole (encoded) file in memory.
+	prefix := string(raw[:len(raw)-1]) + `,"content_base64":true,"content":"`
+	if _, err := s.currentFile.WriteString(prefix); err != nil {
+		return err
+	}
+	enc := base64.NewEncoder(base64.StdEncoding, s.currentFile)
+	n, err := io.Copy(enc, content)
+	if err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	suffix := "\"}\n"
+	if _, err := s.currentFile.WriteString(suffix); err != nil {
+		return err
+	}
+	s.currentSize += int64(len(prefix)) + n + int64(len(suffix))
+	return nil
+}
+
+func (w *ndjsonRecordWriter) WriteDirectoryTree(tree string) error {
+	s := w.state
+	raw, err := json.Marshal(ndjsonRecord{Type: "tree", Content: tree})
+	if err != nil {
+		return err
+	}
+	line := append(raw, '\n')
+	if _, err := s.currentFile.Write(line); err != nil {
+		return err
+	}
+	s.currentSize += int64(len(line))
+	return nil
+}
+
+func (w *ndjsonRecordWriter) Rotate() error { return nil }
+func (w *ndjsonRecordWriter) Close() error  { return nil }
+
+// tarRecordWriter produces a standard tar archive, with a tar.Writer
+// wrapping the current output file. Rotate re-anchors it to the new file;
+// Close flushes the trailer so the archive for that file is valid on its
+// own.
+type tarRecordWriter struct {
+	state *outputState
+	tw    *tar.Writer
+}
+
+func (w *tarRecordWriter) EstimateSize(metadata fileMetadata, contentLength int64) int64 {
+	// One 512-byte header plus content padded up to the next 512-byte
+	// boundary, per the tar format.
+	return 512 + (contentLength+511)/512*512
+}
+
+func (w *tarRecordWriter) WriteRecord(metadata fileMetadata, content io.Reader, contentLength int64) error {
+	hdr := &tar.Header{
+		Name: metadata.relPath,
+		Size: contentLength,
+		Mode: 0644,
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	n, err := io.Copy(w.tw, content)
+	if err != nil {
+		return err
+	}
+	w.state.currentSize += n
+	return nil
+}
+
+func (w *tarRecordWriter) WriteDirectoryTree(tree string) error {
+	hdr := &tar.Header{
+		Name: "DIRECTORY_STRUCTURE.txt",
+		Size: int64(len(tree)),
+		Mode: 0644,
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	n, err := w.tw.Write([]byte(tree))
+	w.state.currentSize += int64(n)
+	return err
+}
+
+func (w *tarRecordWriter) Rotate() error {
+	w.tw = tar.NewWriter(w.state.currentFile)
+	return nil
+}
+
+func (w *tarRecordWriter) Close() error {
+	if w.tw == nil {
+		return nil
+	}
+	return w.tw.Close()
+}
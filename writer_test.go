@@ -0,0 +1,224 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestState(t *testing.T, format string) *outputState {
+	t.Helper()
+	state := &outputState{outputDir: t.TempDir(), format: format, maxFileSize: 1 << 20, fileIndex: 1}
+	writer, err := newRecordWriter(format, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.writer = writer
+	if err := state.createNewOutputFile(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// TestTarRecordWriterSurvivesRollover closes state.currentFile
+		// itself partway through to simulate a rollover; tolerate the
+		// resulting double close here rather than special-casing it there.
+		if err := state.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+			t.Errorf("state.Close() = %v", err)
+		}
+	})
+	return state
+}
+
+func outputPath(state *outputState, format string) string {
+	return filepath.Join(state.outputDir, "output_001"+outputExtension(format))
+}
+
+func TestNewRecordWriterRejectsUnknownFormat(t *testing.T) {
+	if _, err := newRecordWriter("yaml", &outputState{}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestTextRecordWriterRoundTrip(t *testing.T) {
+	state := newTestState(t, "text")
+	metadata := fileMetadata{name: "main.go", relPath: "src/main.go", size: 7}
+
+	if err := state.writer.WriteRecord(metadata, strings.NewReader("content"), 7); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(outputPath(state, "text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "File: main.go\nPath: src/main.go\nSize: 7 bytes\nFILE CONTENT START:\ncontent\nFILE CONTENT END\n\n"
+	if string(data) != want {
+		t.Errorf("output = %q, want %q", data, want)
+	}
+}
+
+func TestNdjsonRecordWriterRoundTripsBase64Content(t *testing.T) {
+	state := newTestState(t, "ndjson")
+	metadata := fileMetadata{name: "bin.dat", relPath: "bin.dat", size: 4}
+	content := []byte{0x00, 0x01, 0xff, 0xfe}
+
+	if err := state.writer.WriteRecord(metadata, bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(outputPath(state, "ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rec ndjsonRecord
+	if err := json.Unmarshal(bytes.TrimSpace(data), &rec); err != nil {
+		t.Fatalf("unmarshaling ndjson record: %v (data: %q)", err, data)
+	}
+	if !rec.ContentBase64 {
+		t.Error("expected content_base64 to be true")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(rec.Content)
+	if err != nil {
+		t.Fatalf("decoding base64 content: %v", err)
+	}
+	if !bytes.Equal(decoded, content) {
+		t.Errorf("decoded content = %v, want %v", decoded, content)
+	}
+	if rec.Size != metadata.size {
+		t.Errorf("rec.Size = %d, want %d", rec.Size, metadata.size)
+	}
+}
+
+func TestNdjsonRecordWriterWriteDirectoryTree(t *testing.T) {
+	state := newTestState(t, "ndjson")
+	if err := state.writer.WriteDirectoryTree("tree\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(outputPath(state, "ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec ndjsonRecord
+	if err := json.Unmarshal(bytes.TrimSpace(data), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Type != "tree" || rec.Content != "tree\n" {
+		t.Errorf("got %+v, want type=tree content=%q", rec, "tree\n")
+	}
+}
+
+func TestTarRecordWriterSurvivesRollover(t *testing.T) {
+	state := newTestState(t, "tar")
+
+	first := fileMetadata{name: "a.txt", relPath: "a.txt", size: 5}
+	if err := state.writer.WriteRecord(first, strings.NewReader("alpha"), 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate outputState rolling over to a new underlying file, as
+	// createNewOutputFile does: advance fileIndex, reopen, Rotate.
+	state.fileIndex = 2
+	newFile, err := os.Create(filepath.Join(state.outputDir, "output_002.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.currentFile = newFile
+	if err := state.writer.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	second := fileMetadata{name: "b.txt", relPath: "b.txt", size: 4}
+	if err := state.writer.WriteRecord(second, strings.NewReader("beta"), 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := newFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// state.currentFile now points at the already-closed newFile; leave it
+	// for newTestState's t.Cleanup, which tolerates a double close.
+
+	assertTarContains(t, filepath.Join(state.outputDir, "output_001.tar"), "a.txt", "alpha")
+	assertTarContains(t, filepath.Join(state.outputDir, "output_002.tar"), "b.txt", "beta")
+}
+
+func assertTarContains(t *testing.T, path, wantName, wantContent string) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			t.Fatalf("%s: did not find entry %q", path, wantName)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != wantName {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != wantContent {
+			t.Errorf("%s entry %q content = %q, want %q", path, wantName, content, wantContent)
+		}
+		return
+	}
+}
+
+func statSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestEstimateSizeRoughlyMatchesWriteRecord(t *testing.T) {
+	content := []byte("the quick brown fox jumps over the lazy dog")
+	metadata := fileMetadata{name: "f.txt", relPath: "f.txt", size: int64(len(content))}
+
+	for _, format := range []string{"text", "ndjson", "tar"} {
+		t.Run(format, func(t *testing.T) {
+			state := newTestState(t, format)
+			estimate := state.writer.EstimateSize(metadata, int64(len(content)))
+
+			before := statSize(t, outputPath(state, format))
+			if err := state.writer.WriteRecord(metadata, bytes.NewReader(content), int64(len(content))); err != nil {
+				t.Fatal(err)
+			}
+			actual := statSize(t, outputPath(state, format)) - before
+
+			// EstimateSize is an upper-bound heuristic (ndjson overestimates
+			// its constant overhead, tar rounds up to a 512-byte boundary),
+			// so just check it's in the right ballpark rather than exact.
+			if estimate < actual {
+				t.Errorf("EstimateSize = %d, actual WriteRecord growth = %d; estimate should not undershoot", estimate, actual)
+			}
+			if estimate > actual*4+512 {
+				t.Errorf("EstimateSize = %d, actual WriteRecord growth = %d; estimate is unreasonably high", estimate, actual)
+			}
+		})
+	}
+}